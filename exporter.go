@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nickpeirson/gearadmin"
+)
+
+// runExporter runs headless, reusing the same multi-host client setup as
+// the TUI, but serving the latest poll as Prometheus metrics instead of
+// drawing with termbox. It blocks until the process is killed.
+func runExporter(addr string) {
+	clients, err := buildClients()
+	if err != nil {
+		fatal(err.Error())
+		return
+	}
+	for _, client := range clients {
+		defer client.Close()
+	}
+	responseFilter := statusFilter(initialiseFilters())
+
+	collector := newMetricsCollector()
+	go collector.run(clients, responseFilter)
+
+	http.Handle("/metrics", collector)
+	logInfo("Exporter listening on " + addr)
+	if err := http.ListenAndServe(addr, nil); err != nil {
+		fatal("Couldn't start exporter: " + err.Error())
+	}
+}
+
+// metricsCollector keeps the latest poll per host (rather than merging
+// hosts together) so that queues with the same name on different hosts
+// don't clobber each other's numbers, and so the exported metrics can
+// carry a `host` label as well as `queue`.
+type metricsCollector struct {
+	mu     sync.Mutex
+	latest map[string]gearadmin.StatusLines
+}
+
+func newMetricsCollector() *metricsCollector {
+	return &metricsCollector{latest: make(map[string]gearadmin.StatusLines)}
+}
+
+func (c *metricsCollector) run(clients []gearadmin.Client, responseFilter gearadmin.StatusLineFilter) {
+	for {
+		start := time.Now()
+		for _, client := range clients {
+			statusLines, err := client.StatusFiltered(responseFilter)
+			if err != nil {
+				logWarn("Exporter poll failed for ", client.ConnectionString(), ": ", err)
+				continue
+			}
+			c.mu.Lock()
+			c.latest[client.ConnectionString()] = statusLines
+			c.mu.Unlock()
+		}
+		duration := time.Since(start)
+		time.Sleep(pollInterval - duration)
+	}
+}
+
+func (c *metricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintln(w, "# HELP gearman_queue_queued Number of jobs queued but not yet running")
+	fmt.Fprintln(w, "# TYPE gearman_queue_queued gauge")
+	for host, lines := range c.latest {
+		for _, line := range lines {
+			fmt.Fprintf(w, "gearman_queue_queued{queue=%q,host=%q} %s\n", line.Name, host, line.Queued)
+		}
+	}
+	fmt.Fprintln(w, "# HELP gearman_queue_running Number of jobs currently running")
+	fmt.Fprintln(w, "# TYPE gearman_queue_running gauge")
+	for host, lines := range c.latest {
+		for _, line := range lines {
+			fmt.Fprintf(w, "gearman_queue_running{queue=%q,host=%q} %s\n", line.Name, host, line.Running)
+		}
+	}
+	fmt.Fprintln(w, "# HELP gearman_queue_workers Number of workers registered for the queue")
+	fmt.Fprintln(w, "# TYPE gearman_queue_workers gauge")
+	for host, lines := range c.latest {
+		for _, line := range lines {
+			fmt.Fprintf(w, "gearman_queue_workers{queue=%q,host=%q} %s\n", line.Name, host, line.Workers)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+type termMatcher func(name string) bool
+
+// compileTerm turns a raw -filterInclude/-filterExclude/search term into a
+// matcher. A "re:" prefix treats the remainder as a (case-insensitive)
+// regular expression; otherwise it's a plain case-insensitive substring
+// match.
+func compileTerm(raw string) termMatcher {
+	if strings.HasPrefix(raw, "re:") {
+		re, err := regexp.Compile("(?i)" + strings.TrimPrefix(raw, "re:"))
+		if err != nil {
+			logWarn("Invalid filter regex ", raw, ": ", err)
+			return func(string) bool { return false }
+		}
+		return func(name string) bool { return re.MatchString(name) }
+	}
+	term := strings.ToLower(raw)
+	return func(name string) bool { return strings.Contains(strings.ToLower(name), term) }
+}
+
+// searchState holds the live `/` search: active is true while the footer
+// prompt is capturing keystrokes, pattern is the raw typed text and
+// matcher is pattern compiled via compileTerm (nil when pattern is empty).
+type searchState struct {
+	active  bool
+	pattern string
+	matcher termMatcher
+}
+
+func (d *display) startSearch() {
+	d.search = searchState{active: true}
+	d.redraw <- true
+}
+
+func (d *display) handleSearchKey(event termbox.Event) {
+	switch event.Key {
+	case termbox.KeyEsc:
+		d.clearSearch()
+		return
+	case termbox.KeyEnter:
+		d.search.active = false
+		d.redraw <- true
+		return
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		if len(d.search.pattern) > 0 {
+			d.search.pattern = d.search.pattern[:len(d.search.pattern)-1]
+		}
+	default:
+		if event.Ch != 0 {
+			d.search.pattern += string(event.Ch)
+		}
+	}
+	if d.search.pattern == "" {
+		d.search.matcher = nil
+	} else {
+		d.search.matcher = compileTerm(d.search.pattern)
+	}
+	d.redraw <- true
+}
+
+func (d *display) clearSearch() {
+	d.search = searchState{}
+	d.redraw <- true
+}
+
+// cycleMatch scrolls to the next (direction>0) or previous (direction<0)
+// row whose name matches the active search, wrapping around the list.
+func (d *display) cycleMatch(direction int) {
+	if d.search.matcher == nil || len(d.statusLines) == 0 {
+		return
+	}
+	n := len(d.statusLines)
+	for i := 1; i <= n; i++ {
+		index := ((d.position+direction*i)%n + n) % n
+		if d.search.matcher(d.statusLines[index].Name) {
+			d.position = index
+			d.redraw <- true
+			return
+		}
+	}
+}
+
+func drawPrompt(prefix, text string, y, width int) {
+	print_tb(0, y, termbox.ColorDefault, termbox.ColorDefault, prefix+text)
+}
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"github.com/nickpeirson/gearadmin"
 	"github.com/nsf/termbox-go"
-	"io/ioutil"
-	"log"
 	"os"
 	"strconv"
 	"strings"
@@ -25,6 +23,13 @@ type display struct {
 	sortField     rune
 	sortAscending bool
 	redraw        chan bool
+	mode          int
+	graphs        *graphStore
+	search        searchState
+	cursor        int
+	selectedName  string
+	workerDetail  *workerDetail
+	exportPrompt  promptState
 }
 
 type fieldWidths struct {
@@ -38,6 +43,7 @@ type fieldWidths struct {
 var pollInterval = 1 * time.Second
 var quit = make(chan bool)
 var statusDisplay = display{}
+var activeClients []gearadmin.Client
 var columnNames = gearadmin.StatusLine{
 	Name:    "Job name",
 	Queued:  "Queued",
@@ -63,19 +69,19 @@ func fieldWidthsFactory(status gearadmin.StatusLines) (widths fieldWidths) {
 	return
 }
 
-var doLogging bool
 var showAll bool
 var gearmanHost string
 var gearmanPort string
 var initialSortIndex string
 var queueNameInclude string
 var queueNameExclude string
+var exporterAddr string
+var logLevelFlag string
+var logFileFlag string
 
 func init() {
-	logDefault := false
-	logUsage := "Log debug to /tmp/gearman_gtop.log"
-	flag.BoolVar(&doLogging, "log", logDefault, logUsage)
-	flag.BoolVar(&doLogging, "l", logDefault, logUsage+" (shorthand)")
+	flag.StringVar(&logLevelFlag, "log-level", "info", "Log level: trace, debug, info, warn or error")
+	flag.StringVar(&logFileFlag, "log-file", "", "Write logs to this file. Logging is disabled if unset")
 	allDefault := false
 	allUsage := "Show all queues, even if the have no workers or jobs"
 	flag.BoolVar(&showAll, "all", allDefault, allUsage)
@@ -85,27 +91,42 @@ func init() {
 	flag.StringVar(&gearmanHost, "host", hostDefault, hostUsage)
 	flag.StringVar(&gearmanHost, "h", hostDefault, hostUsage+" (shorthand)")
 	flag.StringVar(&initialSortIndex, "sort", "1", "Index of the column to sort by")
-	flag.StringVar(&queueNameInclude, "filterInclude", "", "Include queues containing this string. Can provide multiple separated by commas.")
-	flag.StringVar(&queueNameExclude, "filterExclude", "", "Exclude queues containing this string. Can provide multiple separated by commas.")
+	flag.StringVar(&queueNameInclude, "filterInclude", "", "Include queues containing this string, or matching a regex given as 're:<pattern>'. Can provide multiple separated by commas.")
+	flag.StringVar(&queueNameExclude, "filterExclude", "", "Exclude queues containing this string, or matching a regex given as 're:<pattern>'. Can provide multiple separated by commas.")
+	flag.StringVar(&exporterAddr, "exporter", "", "Run headless, exposing Prometheus metrics on this address (e.g. ':9109') instead of drawing the TUI")
 	statusDisplay.redraw = make(chan bool, 5)
+	statusDisplay.graphs = newGraphStore()
 }
 
 func main() {
 	flag.Parse()
-	if doLogging {
-		defer (initLogging()).Close()
-	} else {
-		log.SetOutput(ioutil.Discard)
+	level, err := parseLevel(logLevelFlag)
+	if err != nil {
+		fatal(err.Error())
+	}
+	appLog.setLevel(level)
+	if logFileFlag != "" {
+		f, err := initLogging(logFileFlag, level)
+		if err != nil {
+			fatal(err.Error())
+		}
+		defer f.Close()
 	}
 	statusDisplay.sortEvent(rune(initialSortIndex[0]))
 
-	err := termbox.Init()
+	if exporterAddr != "" {
+		runExporter(exporterAddr)
+		return
+	}
+
+	err = termbox.Init()
 	if err != nil {
 		fatal(err.Error())
 	}
 	defer termbox.Close()
+	defer recoverFromPanic()
 	termbox.SetInputMode(termbox.InputEsc)
-	log.Println("Termbox initialised")
+	logInfo("Termbox initialised")
 
 	statusDisplay.resize(termbox.Size())
 
@@ -113,122 +134,224 @@ func main() {
 	go handleEvents()
 	go statusDisplay.draw()
 	<-quit
-	log.Println("Exiting")
+	logInfo("Exiting")
 	return
 }
 
 func handleEvents() {
+	defer recoverFromPanic()
 	for {
 		event := termbox.PollEvent()
-		log.Println("Recieved event: ", event)
+		logDebug("Recieved event: ", event)
 		switch event.Type {
 		case termbox.EventKey:
+			if statusDisplay.search.active {
+				statusDisplay.handleSearchKey(event)
+				continue
+			}
+			if statusDisplay.exportPrompt.active {
+				statusDisplay.handleExportPromptKey(event)
+				continue
+			}
 			switch event.Ch {
 			case 'q':
 				quit <- true
 			case '1', '2', '3', '4':
 				statusDisplay.sortEvent(event.Ch)
+			case 'g':
+				statusDisplay.toggleMode()
+			case '/':
+				statusDisplay.startSearch()
+			case 's':
+				statusDisplay.startExportPrompt()
+			case 'n':
+				statusDisplay.cycleMatch(+1)
+			case 'N':
+				statusDisplay.cycleMatch(-1)
 			default:
 				switch event.Key {
 				case termbox.KeyCtrlC:
 					quit <- true
 				case termbox.KeyArrowUp:
-					statusDisplay.scrollOutput(-1)
+					statusDisplay.moveCursor(-1)
 				case termbox.KeyArrowDown:
-					statusDisplay.scrollOutput(+1)
+					statusDisplay.moveCursor(+1)
+				case termbox.KeyPgup:
+					statusDisplay.scrollOutput(-statusDisplay.numberOfRows)
+				case termbox.KeyPgdn:
+					statusDisplay.scrollOutput(+statusDisplay.numberOfRows)
+				case termbox.KeyHome:
+					statusDisplay.scrollOutput(-len(statusDisplay.statusLines))
+				case termbox.KeyEnd:
+					statusDisplay.scrollOutput(+len(statusDisplay.statusLines))
+				case termbox.KeyEnter:
+					statusDisplay.openWorkerView(activeClients)
+				case termbox.KeyEsc:
+					if statusDisplay.mode == modeWorkers {
+						statusDisplay.closeWorkerView()
+					} else {
+						statusDisplay.clearSearch()
+					}
 				}
 			}
 		case termbox.EventResize:
-			log.Println("Redrawing for resize")
+			logDebug("Redrawing for resize")
 			statusDisplay.resize(event.Width, event.Height)
 		}
 	}
 }
 
-func (d *display) updateLines() {
-	log.Println("Connecting to gearman")
+// buildClients parses the (possibly ';'-separated) -host flag into one
+// gearadmin.Client per gearmand instance.
+func buildClients() ([]gearadmin.Client, error) {
 	connectionDetails := strings.Split(gearmanHost, ";")
 	var clients []gearadmin.Client
 	for _, connectionDetail := range connectionDetails {
 		splitConnectionDetail := strings.Split(connectionDetail, ":")
 		if len(splitConnectionDetail) > 2 {
-			fatal("Invalid connection string: " + connectionDetail)
-			return
+			return nil, fmt.Errorf("Invalid connection string: " + connectionDetail)
 		}
 		host := splitConnectionDetail[0]
 		port := "4730"
 		if len(splitConnectionDetail) == 2 {
 			port = splitConnectionDetail[1]
 		}
-		gearadminClient := gearadmin.New(host, port)
-		defer gearadminClient.Close()
-		clients = append(clients, gearadminClient)
+		clients = append(clients, gearadmin.New(host, port))
+	}
+	return clients, nil
+}
+
+// collectStatus polls every client once and merges the results. It doesn't
+// touch termbox. The Prometheus exporter doesn't use it: it keeps each
+// host's lines separate (see metricsCollector.run).
+func collectStatus(clients []gearadmin.Client, responseFilter gearadmin.StatusLineFilter) (gearadmin.StatusLines, error) {
+	statusLines := gearadmin.StatusLines{}
+	for _, client := range clients {
+		newStatusLines, err := client.StatusFiltered(responseFilter)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't get gearman status from " + client.ConnectionString() + " (Error: " + err.Error() + ")")
+		}
+		statusLines = statusLines.Merge(newStatusLines)
+	}
+	return statusLines, nil
+}
+
+// applyStatusLines installs a freshly polled (or replayed) set of status
+// lines and triggers a redraw, regardless of where they came from.
+func (d *display) applyStatusLines(statusLines gearadmin.StatusLines) {
+	d.statusLines = statusLines
+	d.sortLines()
+	d.fieldWidths = fieldWidthsFactory(statusLines)
+	d.graphs.append(statusLines)
+	d.reconcileCursor()
+	d.redraw <- true
+}
+
+func (d *display) updateLines() {
+	defer recoverFromPanic()
+	if replayPath != "" {
+		d.replayLines()
+		return
+	}
+	logInfo("Connecting to gearman")
+	clients, err := buildClients()
+	if err != nil {
+		fatal(err.Error())
+		return
 	}
+	for _, client := range clients {
+		defer client.Close()
+	}
+	activeClients = clients
 	responseFilter := statusFilter(initialiseFilters())
 	for {
-		log.Println("Getting status")
+		logTrace("Getting status")
 		start := time.Now()
-		statusLines := gearadmin.StatusLines{}
-		for _, client := range clients {
-			newStatusLines, err := client.StatusFiltered(responseFilter)
-			if err != nil {
-				fatal("Couldn't get gearman status from " + client.ConnectionString() + " (Error: " + err.Error() + ")")
-				return
+		statusLines, err := collectStatus(clients, responseFilter)
+		if err != nil {
+			fatal(err.Error())
+			return
+		}
+		if recordPath != "" {
+			if err := appendSnapshot(recordPath, statusLines); err != nil {
+				logWarn("Couldn't record snapshot: ", err)
 			}
-			statusLines = statusLines.Merge(newStatusLines)
 		}
-		d.statusLines = statusLines
-		d.sortLines()
-		d.fieldWidths = fieldWidthsFactory(statusLines)
-		d.redraw <- true
+		d.applyStatusLines(statusLines)
 		duration := time.Since(start)
 		time.Sleep(pollInterval - duration)
 	}
 }
 
 func (d *display) scrollOutput(direction int) {
-	log.Println("Scrolling")
-	scrolledToTop := d.position == 0
-	scrolledToBottom := len(d.statusLines)-d.position <= d.numberOfRows
-	if (direction < 0 && !scrolledToTop) || (direction > 0 && !scrolledToBottom) {
-		log.Println("Moving")
-		d.position += direction
+	logTrace("Scrolling")
+	maxPosition := len(d.statusLines) - d.numberOfRows
+	if maxPosition < 0 {
+		maxPosition = 0
+	}
+	newPosition := d.position + direction
+	if newPosition < 0 {
+		newPosition = 0
+	} else if newPosition > maxPosition {
+		newPosition = maxPosition
+	}
+	if newPosition != d.position {
+		logTrace("Moving")
+		d.position = newPosition
 		d.redraw <- true
 	}
 }
 
 func (d *display) draw() {
+	defer recoverFromPanic()
 	for {
 		<-d.redraw
-		lines := d.statusLines
-
-		widths := d.fieldWidths
-		widths.name += d.width - widths.total
-
 		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
-		if len(lines) > 0 {
-			log.Print("First line: ", lines[0])
-			log.Print("Last line: ", lines[len(lines)-1])
-		} else {
-			log.Print("No lines")
-		}
-		d.headerHeight = drawHeader(widths)
-		d.footerHeight = drawFooter(lines, d.position, d.height, d.width)
-		d.numberOfRows = d.height - d.headerHeight - d.footerHeight
-		printY := d.headerHeight
-		printLines := lines[d.position:]
-		if len(printLines) > d.numberOfRows {
-			printLines = printLines[:d.numberOfRows]
-		}
-		for _, line := range printLines {
-			drawLine(printY, widths, line, false)
-			printY++
+		switch d.mode {
+		case modeGraph:
+			d.drawGraphs()
+		case modeWorkers:
+			d.drawWorkerView()
+		default:
+			d.drawList()
 		}
-
 		termbox.Flush()
 	}
 }
 
+func (d *display) drawList() {
+	lines := d.statusLines
+
+	widths := d.fieldWidths
+	widths.name += d.width - widths.total
+
+	if len(lines) > 0 {
+		logTrace("First line: ", lines[0])
+		logTrace("Last line: ", lines[len(lines)-1])
+	} else {
+		logTrace("No lines")
+	}
+	d.headerHeight = drawHeader(widths)
+	d.footerHeight = drawFooter(lines, d.position, d.height, d.width)
+	d.numberOfRows = d.height - d.headerHeight - d.footerHeight
+	printY := d.headerHeight
+	printLines := lines[d.position:]
+	if len(printLines) > d.numberOfRows {
+		printLines = printLines[:d.numberOfRows]
+	}
+	for i, line := range printLines {
+		matched := d.search.matcher != nil && d.search.matcher(line.Name)
+		selected := d.position+i == d.cursor
+		drawLine(printY, widths, line, matched || selected)
+		printY++
+	}
+	if d.exportPrompt.active {
+		drawPrompt("Export CSV to: ", d.exportPrompt.text, d.height-d.footerHeight, d.width)
+	} else if d.search.active {
+		drawPrompt("/", d.search.pattern, d.height-d.footerHeight, d.width)
+	}
+}
+
 func drawHeader(widths fieldWidths) int {
 	drawLine(0, widths, columnNames, true)
 	return 1
@@ -267,7 +390,7 @@ func drawFooter(sl gearadmin.StatusLines, position, y, width int) (footerHeight
 	return
 }
 
-func statusFilter(includeTerms, excludeTerms []string) gearadmin.StatusLineFilter {
+func statusFilter(includeTerms, excludeTerms []termMatcher) gearadmin.StatusLineFilter {
 	return func(line gearadmin.StatusLine) bool {
 		if !showAll && line.Queued == "0" &&
 			line.Running == "0" && line.Workers == "0" {
@@ -276,14 +399,13 @@ func statusFilter(includeTerms, excludeTerms []string) gearadmin.StatusLineFilte
 		if len(includeTerms) == 0 && len(excludeTerms) == 0 {
 			return true
 		}
-		name := strings.ToLower(line.Name)
-		for _, excludeTerm := range excludeTerms {
-			if strings.Contains(name, excludeTerm) {
+		for _, exclude := range excludeTerms {
+			if exclude(line.Name) {
 				return false
 			}
 		}
-		for _, includeTerm := range includeTerms {
-			if strings.Contains(name, includeTerm) {
+		for _, include := range includeTerms {
+			if include(line.Name) {
 				return true
 			}
 		}
@@ -291,17 +413,19 @@ func statusFilter(includeTerms, excludeTerms []string) gearadmin.StatusLineFilte
 	}
 }
 
-func initialiseFilters() (include, exclude []string) {
+func initialiseFilters() (include, exclude []termMatcher) {
 	if len(queueNameInclude) > 0 {
-		queueNameInclude = strings.ToLower(queueNameInclude)
-		include = strings.Split(queueNameInclude, ",")
+		for _, term := range strings.Split(queueNameInclude, ",") {
+			include = append(include, compileTerm(term))
+		}
 	}
 	if len(queueNameExclude) > 0 {
-		queueNameExclude = strings.ToLower(queueNameExclude)
-		exclude = strings.Split(queueNameExclude, ",")
+		for _, term := range strings.Split(queueNameExclude, ",") {
+			exclude = append(exclude, compileTerm(term))
+		}
 	}
-	log.Printf("Including: %d %v", len(include), include)
-	log.Printf("Excluding: %d %v", len(exclude), exclude)
+	logDebugf("Including: %d terms", len(include))
+	logDebugf("Excluding: %d terms", len(exclude))
 	return
 }
 
@@ -317,7 +441,7 @@ func (d *display) sortLines() {
 }
 
 func (d *display) sortEvent(index rune) {
-	log.Println("Handling sort event")
+	logTrace("Handling sort event")
 	if d.sortField == index {
 		d.sortAscending = !d.sortAscending
 	} else if index == '1' {
@@ -327,27 +451,17 @@ func (d *display) sortEvent(index rune) {
 	}
 	d.sortField = index
 	d.sortLines()
-	log.Printf("%#v\n", d.redraw)
+	d.reconcileCursor()
 	d.redraw <- true
 }
 
 func (d *display) resize(width, height int) {
-	log.Println("Display resized")
+	logDebug("Display resized")
 	d.height = height
 	d.width = width
 	d.redraw <- true
 }
 
-func initLogging() *os.File {
-	f, err := os.OpenFile("/tmp/gearman_gtop.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		panic(err)
-	}
-	log.SetOutput(f)
-	log.Println("Logging initialised")
-	return f
-}
-
 func print_tb(x, y int, fg, bg termbox.Attribute, msg string) {
 	for _, c := range msg {
 		termbox.SetCell(x, y, c, fg, bg)
@@ -357,7 +471,7 @@ func print_tb(x, y int, fg, bg termbox.Attribute, msg string) {
 
 func fatal(msg string) {
 	termbox.Close()
-	log.Println("Exiting: ", msg)
+	logError("Exiting: ", msg)
 	fmt.Println(msg)
 	os.Exit(2)
 }
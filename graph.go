@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/nickpeirson/gearadmin"
+	"github.com/nsf/termbox-go"
+)
+
+const (
+	modeList = iota
+	modeGraph
+	modeWorkers
+)
+
+// graphWindowSize is the number of polls kept per queue, i.e. the rolling
+// time window shown by the graph mode. At the default 1s pollInterval that's
+// a couple of minutes of history.
+const graphWindowSize = 120
+
+const maxGraphPanes = 4
+
+type sample struct {
+	queued  int
+	running int
+	workers int
+}
+
+type queueHistory struct {
+	samples [graphWindowSize]sample
+	count   int
+	next    int
+}
+
+func (h *queueHistory) push(s sample) {
+	h.samples[h.next] = s
+	h.next = (h.next + 1) % graphWindowSize
+	if h.count < graphWindowSize {
+		h.count++
+	}
+}
+
+func (h *queueHistory) ordered() []sample {
+	ordered := make([]sample, h.count)
+	start := h.next - h.count
+	if start < 0 {
+		start += graphWindowSize
+	}
+	for i := 0; i < h.count; i++ {
+		ordered[i] = h.samples[(start+i)%graphWindowSize]
+	}
+	return ordered
+}
+
+// graphStore keeps a ring-buffer of samples per queue name, appended to on
+// every poll by updateLines.
+type graphStore struct {
+	histories map[string]*queueHistory
+	order     []string
+}
+
+func newGraphStore() *graphStore {
+	return &graphStore{histories: make(map[string]*queueHistory)}
+}
+
+func (g *graphStore) append(lines gearadmin.StatusLines) {
+	for _, line := range lines {
+		history, ok := g.histories[line.Name]
+		if !ok {
+			history = &queueHistory{}
+			g.histories[line.Name] = history
+			g.order = append(g.order, line.Name)
+		}
+		history.push(sample{
+			queued:  atoiOrZero(line.Queued),
+			running: atoiOrZero(line.Running),
+			workers: atoiOrZero(line.Workers),
+		})
+	}
+}
+
+func atoiOrZero(value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func (d *display) toggleMode() {
+	if d.mode == modeList {
+		d.mode = modeGraph
+	} else {
+		d.mode = modeList
+	}
+	logDebug("Toggled display mode")
+	d.redraw <- true
+}
+
+type rect struct {
+	x, y, width, height int
+}
+
+// paneLayout divides the available space into 1, 2 or 4 cells depending on
+// how many queues are being graphed.
+func paneLayout(width, height, n int) []rect {
+	cols, rows := 1, 1
+	switch {
+	case n >= 3:
+		cols, rows = 2, 2
+	case n == 2:
+		cols, rows = 2, 1
+	}
+	paneWidth := width / cols
+	paneHeight := height / rows
+	panes := make([]rect, 0, cols*rows)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			panes = append(panes, rect{x: c * paneWidth, y: r * paneHeight, width: paneWidth, height: paneHeight})
+		}
+	}
+	return panes
+}
+
+func (d *display) drawGraphs() {
+	names := d.graphs.order
+	if len(names) > maxGraphPanes {
+		names = names[:maxGraphPanes]
+	}
+	panes := paneLayout(d.width, d.height, len(names))
+	for i, name := range names {
+		drawGraphPane(panes[i], name, d.graphs.histories[name].ordered())
+	}
+}
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+func minMax(values []int) (lowest, highest int) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	lowest, highest = values[0], values[0]
+	for _, v := range values {
+		if v < lowest {
+			lowest = v
+		}
+		if v > highest {
+			highest = v
+		}
+	}
+	return lowest, highest
+}
+
+func sparkline(values []int, width int) string {
+	if len(values) == 0 || width <= 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	lowest, highest := minMax(values)
+	spread := highest - lowest
+	line := make([]rune, len(values))
+	for i, v := range values {
+		if spread == 0 {
+			line[i] = sparkChars[0]
+			continue
+		}
+		line[i] = sparkChars[(v-lowest)*(len(sparkChars)-1)/spread]
+	}
+	return string(line)
+}
+
+// drawSparkRow draws one metric's axis (its min/max over the window) and
+// sparkline on a single row, e.g. "Q [0..12] ▁▂▃▅█".
+func drawSparkRow(x, y, paneWidth int, label string, values []int) {
+	lowest, highest := minMax(values)
+	prefix := fmt.Sprintf("%s [%d..%d] ", label, lowest, highest)
+	sparkWidth := paneWidth - len(prefix)
+	if sparkWidth < 0 {
+		sparkWidth = 0
+	}
+	print_tb(x, y, termbox.ColorDefault, termbox.ColorDefault, prefix+sparkline(values, sparkWidth))
+}
+
+func drawGraphPane(r rect, name string, samples []sample) {
+	print_tb(r.x, r.y, termbox.ColorDefault|termbox.AttrBold, termbox.ColorDefault, name)
+	if r.height < 4 || r.width < 4 {
+		return
+	}
+	queued := make([]int, len(samples))
+	running := make([]int, len(samples))
+	workers := make([]int, len(samples))
+	for i, s := range samples {
+		queued[i] = s.queued
+		running[i] = s.running
+		workers[i] = s.workers
+	}
+	drawSparkRow(r.x, r.y+1, r.width, "Q", queued)
+	drawSparkRow(r.x, r.y+2, r.width, "R", running)
+	drawSparkRow(r.x, r.y+3, r.width, "W", workers)
+	if len(samples) > 0 {
+		latest := samples[len(samples)-1]
+		summary := fmt.Sprintf("latest q=%d r=%d w=%d", latest.queued, latest.running, latest.workers)
+		print_tb(r.x, r.y+4, termbox.ColorDefault, termbox.ColorDefault, summary)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Level is a log severity, ordered so that Level comparisons can be used to
+// decide whether a given log call should be emitted.
+type Level int
+
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelTrace:
+		return "TRACE"
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func parseLevel(value string) (Level, error) {
+	switch strings.ToLower(value) {
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", value)
+}
+
+// logger is effectively a no-op until a sink is configured via
+// initLogging, so call sites can log freely without first checking whether
+// logging is enabled.
+type logger struct {
+	level Level
+	out   *log.Logger
+}
+
+var appLog = &logger{level: LevelInfo, out: log.New(ioutil.Discard, "", log.LstdFlags)}
+
+func (l *logger) log(level Level, v ...interface{}) {
+	if level < l.level {
+		return
+	}
+	l.out.Output(3, level.String()+" "+fmt.Sprintln(v...))
+}
+
+func (l *logger) logf(level Level, format string, v ...interface{}) {
+	if level < l.level {
+		return
+	}
+	l.out.Output(3, level.String()+" "+fmt.Sprintf(format, v...))
+}
+
+func (l *logger) setLevel(level Level) {
+	l.level = level
+}
+
+func logTrace(v ...interface{})                 { appLog.log(LevelTrace, v...) }
+func logDebug(v ...interface{})                 { appLog.log(LevelDebug, v...) }
+func logInfo(v ...interface{})                  { appLog.log(LevelInfo, v...) }
+func logWarn(v ...interface{})                  { appLog.log(LevelWarn, v...) }
+func logError(v ...interface{})                 { appLog.log(LevelError, v...) }
+func logDebugf(format string, v ...interface{}) { appLog.logf(LevelDebug, format, v...) }
+func logInfof(format string, v ...interface{})  { appLog.logf(LevelInfo, format, v...) }
+
+// initLogging points appLog at path, replacing the no-op sink. Callers are
+// responsible for closing the returned file.
+func initLogging(path string, level Level) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	appLog.out = log.New(f, "", log.LstdFlags)
+	appLog.setLevel(level)
+	logInfo("Logging initialised")
+	return f, nil
+}
+
+// recoverFromPanic restores the terminal before a crash dump hits stderr,
+// so a panic doesn't leave the user's TTY in a garbled termbox state.
+func recoverFromPanic() {
+	if r := recover(); r != nil {
+		termbox.Close()
+		logError("panic: ", r)
+		fmt.Fprintln(os.Stderr, "gearman_gtop: panic:", r)
+		fmt.Fprintln(os.Stderr, string(debug.Stack()))
+		os.Exit(2)
+	}
+}
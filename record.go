@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nickpeirson/gearadmin"
+	"github.com/nsf/termbox-go"
+)
+
+var recordPath string
+var replayPath string
+var replaySpeed float64
+
+func init() {
+	flag.StringVar(&recordPath, "record", "", "Append a timestamped JSON-lines snapshot of every poll to this file")
+	flag.StringVar(&replayPath, "replay", "", "Replay poll snapshots from a file written by -record instead of polling gearmand")
+	flag.Float64Var(&replaySpeed, "speed", 1, "Replay speed multiplier relative to the original -replay recording's poll interval")
+}
+
+// snapshot is one line of a -record file: the merged, already-filtered
+// status lines from a single poll cycle.
+type snapshot struct {
+	Time  time.Time             `json:"time"`
+	Lines gearadmin.StatusLines `json:"lines"`
+}
+
+func appendSnapshot(path string, lines gearadmin.StatusLines) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(snapshot{Time: time.Now(), Lines: lines})
+}
+
+// replayLines feeds applyStatusLines from a -record file instead of a live
+// gearmand connection, honoring pollInterval scaled by -speed.
+func (d *display) replayLines() {
+	logInfo("Replaying snapshots from ", replayPath)
+	f, err := os.Open(replayPath)
+	if err != nil {
+		fatal(err.Error())
+		return
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	for {
+		var snap snapshot
+		if err := decoder.Decode(&snap); err != nil {
+			if err == io.EOF {
+				logInfo("Replay finished")
+				return
+			}
+			fatal(err.Error())
+			return
+		}
+		d.applyStatusLines(snap.Lines)
+		time.Sleep(time.Duration(float64(pollInterval) / replaySpeed))
+	}
+}
+
+// promptState is a single-line footer text entry, used for the 's' CSV
+// export path prompt.
+type promptState struct {
+	active bool
+	text   string
+}
+
+func (d *display) startExportPrompt() {
+	d.exportPrompt = promptState{active: true}
+	d.redraw <- true
+}
+
+func (d *display) handleExportPromptKey(event termbox.Event) {
+	switch event.Key {
+	case termbox.KeyEsc:
+		d.exportPrompt = promptState{}
+		d.redraw <- true
+		return
+	case termbox.KeyEnter:
+		path := d.exportPrompt.text
+		d.exportPrompt = promptState{}
+		if path != "" {
+			if err := d.exportCSV(path); err != nil {
+				logWarn("Couldn't export CSV: ", err)
+			} else {
+				logInfo("Exported CSV to ", path)
+			}
+		}
+		d.redraw <- true
+		return
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		if len(d.exportPrompt.text) > 0 {
+			d.exportPrompt.text = d.exportPrompt.text[:len(d.exportPrompt.text)-1]
+		}
+	default:
+		if event.Ch != 0 {
+			d.exportPrompt.text += string(event.Ch)
+		}
+	}
+	d.redraw <- true
+}
+
+// exportCSV writes the currently visible (sorted, filtered) table to path.
+func (d *display) exportCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	defer writer.Flush()
+	header := []string{columnNames.Name, columnNames.Queued, columnNames.Running, columnNames.Workers}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, line := range d.statusLines {
+		row := []string{line.Name, line.Queued, line.Running, line.Workers}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
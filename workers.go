@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nickpeirson/gearadmin"
+	"github.com/nsf/termbox-go"
+)
+
+// hostStatus is one host's view of a single queue.
+type hostStatus struct {
+	host    string
+	queued  string
+	running string
+	workers string
+}
+
+// workerDetail is the state shown by the modeWorkers drill-down pane: a
+// per-host breakdown of the currently selected queue, fetched on demand
+// when the user presses Enter on that row.
+//
+// gearadmin.Client only exposes StatusFiltered/ConnectionString/Close, so
+// this is the most granular view available without an upstream change to
+// the gearadmin dependency; it can't show individual worker connections.
+type workerDetail struct {
+	queue string
+	hosts []hostStatus
+}
+
+// moveCursor moves the highlighted row by direction, clamping to the
+// status line list and scrolling the view to keep the cursor visible.
+// The selection is remembered by queue name (selectedName), not just the
+// index, since a poll can re-sort d.statusLines under the cursor.
+func (d *display) moveCursor(direction int) {
+	if len(d.statusLines) == 0 {
+		return
+	}
+	newCursor := d.cursor + direction
+	if newCursor < 0 {
+		newCursor = 0
+	} else if newCursor > len(d.statusLines)-1 {
+		newCursor = len(d.statusLines) - 1
+	}
+	d.cursor = newCursor
+	d.selectedName = d.statusLines[d.cursor].Name
+	if d.cursor < d.position {
+		d.position = d.cursor
+	} else if d.numberOfRows > 0 && d.cursor >= d.position+d.numberOfRows {
+		d.position = d.cursor - d.numberOfRows + 1
+	}
+	d.redraw <- true
+}
+
+// reconcileCursor re-resolves d.cursor against d.selectedName after every
+// poll/sort. Re-sorting (e.g. by Queued/Running/Workers, which change
+// every poll) reshuffles row order even though the same queue is still
+// selected, so the index alone can't be trusted across a sort. If the
+// selected queue has disappeared entirely, the cursor is clamped into
+// range and the selection follows whatever queue now occupies it.
+func (d *display) reconcileCursor() {
+	if len(d.statusLines) == 0 {
+		d.cursor = 0
+		d.selectedName = ""
+		return
+	}
+	if d.selectedName != "" {
+		for i, line := range d.statusLines {
+			if line.Name == d.selectedName {
+				d.cursor = i
+				return
+			}
+		}
+	}
+	if d.cursor >= len(d.statusLines) {
+		d.cursor = len(d.statusLines) - 1
+	}
+	if d.cursor < 0 {
+		d.cursor = 0
+	}
+	d.selectedName = d.statusLines[d.cursor].Name
+}
+
+func (d *display) selectedQueue() (gearadmin.StatusLine, bool) {
+	if d.cursor < 0 || d.cursor >= len(d.statusLines) {
+		return gearadmin.StatusLine{}, false
+	}
+	return d.statusLines[d.cursor], true
+}
+
+// openWorkerView fetches the currently selected queue's status from every
+// host individually and switches to the detail pane.
+func (d *display) openWorkerView(clients []gearadmin.Client) {
+	line, ok := d.selectedQueue()
+	if !ok {
+		return
+	}
+	logDebug("Fetching per-host breakdown for queue ", line.Name)
+	queueFilter := func(candidate gearadmin.StatusLine) bool {
+		return candidate.Name == line.Name
+	}
+	var hosts []hostStatus
+	for _, client := range clients {
+		statusLines, err := client.StatusFiltered(queueFilter)
+		if err != nil {
+			logWarn("Couldn't get status from ", client.ConnectionString(), ": ", err)
+			continue
+		}
+		for _, statusLine := range statusLines {
+			hosts = append(hosts, hostStatus{
+				host:    client.ConnectionString(),
+				queued:  statusLine.Queued,
+				running: statusLine.Running,
+				workers: statusLine.Workers,
+			})
+		}
+	}
+	d.workerDetail = &workerDetail{queue: line.Name, hosts: hosts}
+	d.mode = modeWorkers
+	d.redraw <- true
+}
+
+func (d *display) closeWorkerView() {
+	d.workerDetail = nil
+	d.mode = modeList
+	d.redraw <- true
+}
+
+func (d *display) drawWorkerView() {
+	detail := d.workerDetail
+	if detail == nil {
+		return
+	}
+	print_tb(0, 0, termbox.ColorDefault|termbox.AttrBold, termbox.ColorDefault, "Hosts for "+detail.queue+" (Esc to go back)")
+	y := 1
+	for _, host := range detail.hosts {
+		line := fmt.Sprintf("%s queued=%s running=%s workers=%s", host.host, host.queued, host.running, host.workers)
+		print_tb(0, y, termbox.ColorDefault, termbox.ColorDefault, line)
+		y++
+	}
+	if len(detail.hosts) == 0 {
+		print_tb(0, y, termbox.ColorDefault, termbox.ColorDefault, "No hosts reported this queue")
+	}
+}